@@ -0,0 +1,503 @@
+package pretty
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/kr/text"
+)
+
+// Diff returns a and b rendered as Go source, the same way Formatter would,
+// but with "-"/"+" gutter markers on the struct fields, map entries, slice
+// elements and pointer targets that changed between them.
+func Diff(a, b interface{}) string {
+	return fmt.Sprintf("%# v", DiffFormatter(a, b))
+}
+
+// DiffFormatter makes a wrapper, f, that formats the diff between a and b as
+// Go source with line breaks and tabs, following the same "%# v" contract as
+// Formatter.
+func DiffFormatter(a, b interface{}) (f fmt.Formatter) {
+	return diffFormatter{a: reflect.ValueOf(a), b: reflect.ValueOf(b)}
+}
+
+type diffFormatter struct {
+	a, b reflect.Value
+}
+
+func (fo diffFormatter) Format(f fmt.State, c rune) {
+	if c == 'v' && f.Flag('#') && f.Flag(' ') {
+		w := newTabWriter(f, nil)
+		p := &printer{tw: w, Writer: w, visited: make(map[visit]bool)}
+		p.diffValue(fo.a, fo.b, true)
+		w.Flush()
+
+		return
+	}
+	fmt.Fprintf(f, "%v / %v", fo.a, fo.b)
+}
+
+// signedIndent works like printer.indent, but prefixes every line of the
+// nested block with sign instead of a tab, so a reader can tell at a glance
+// which branch of a diff a line belongs to.
+func (p *printer) signedIndent(sign byte) *printer {
+	q := *p
+	q.tw = newTabWriter(p.Writer, p.cfg)
+	q.Writer = text.NewIndentWriter(q.tw, []byte{sign, ' '})
+
+	return &q
+}
+
+// printSigned prints v the same way printValue would, with every line
+// prefixed by sign, terminated by a newline so that a second, differently
+// signed block can follow it on its own line.
+func (p *printer) printSigned(v reflect.Value, showType bool, sign byte) {
+	pp := p.signedIndent(sign)
+	pp.printValue(v, showType, true)
+	io.WriteString(pp, "\n")
+	pp.tw.Flush()
+}
+
+// diffValue prints a and b as a single value when they are equal, and
+// recurses into structs, maps, arrays/slices and pointers to annotate
+// exactly what changed. Anywhere the two sides stop being directly
+// comparable (different types, a leaf value, one side missing) it falls back
+// to printing both branches in full, signed "-" and "+".
+func (p *printer) diffValue(a, b reflect.Value, showType bool) {
+	switch {
+	case !a.IsValid() && !b.IsValid():
+		io.WriteString(p, "nil")
+	case !a.IsValid():
+		p.printSigned(b, showType, '+')
+	case !b.IsValid():
+		p.printSigned(a, showType, '-')
+	case a.Type() != b.Type():
+		p.printSigned(a, showType, '-')
+		p.printSigned(b, showType, '+')
+	case equalValue(a, b):
+		p.printValue(a, showType, true)
+	default:
+		switch a.Kind() {
+		case reflect.Ptr:
+			ea, eb := a.Elem(), b.Elem()
+			if !ea.IsValid() || !eb.IsValid() {
+				p.printSigned(a, showType, '-')
+				p.printSigned(b, showType, '+')
+
+				return
+			}
+			switch p.visitState(ea, eb) {
+			case bothVisited:
+				writeByte(p, '&')
+				p.fmtString(ea.Type().String()+"{(CYCLIC REFERENCE)}", false)
+
+				return
+			case oneVisited:
+				// Only one side loops back to an ancestor while the other
+				// is a genuinely different value, so show both sides in
+				// full (each safe on its own via printValue's existing
+				// cycle guard) instead of collapsing a real difference
+				// into a single cyclic marker.
+				p.printSigned(a, showType, '-')
+				p.printSigned(b, showType, '+')
+
+				return
+			}
+			writeByte(p, '&')
+			p.diffValue(ea, eb, true)
+		case reflect.Interface:
+			p.diffValue(a.Elem(), b.Elem(), showType)
+		case reflect.Struct:
+			p.diffStruct(a, b, showType)
+		case reflect.Map:
+			switch p.visitState(a, b) {
+			case bothVisited:
+				p.fmtString(a.Type().String()+"{(CYCLIC REFERENCE)}", false)
+
+				return
+			case oneVisited:
+				p.printSigned(a, showType, '-')
+				p.printSigned(b, showType, '+')
+
+				return
+			}
+			p.diffMap(a, b, showType)
+		case reflect.Array, reflect.Slice:
+			switch p.visitState(a, b) {
+			case bothVisited:
+				p.fmtString(a.Type().String()+"{(CYCLIC REFERENCE)}", false)
+
+				return
+			case oneVisited:
+				p.printSigned(a, showType, '-')
+				p.printSigned(b, showType, '+')
+
+				return
+			}
+			p.diffSlice(a, b, showType)
+		default:
+			p.printSigned(a, showType, '-')
+			p.printSigned(b, showType, '+')
+		}
+	}
+}
+
+// ptrVisitState describes how many sides of a (ea, eb) pair are already
+// being diffed higher up the call stack.
+type ptrVisitState int
+
+const (
+	noneVisited ptrVisitState = iota
+	oneVisited
+	bothVisited
+)
+
+// visitState reports whether ea, eb (or both) are values already being
+// diffed higher up the call stack, meaning recursing into them again would
+// loop forever. When both sides loop back to an ancestor it's a true cycle
+// in the diffed pair; when only one does, the other side is a genuinely
+// different value that still needs to be shown in full.
+func (p *printer) visitState(ea, eb reflect.Value) ptrVisitState {
+	seenA := p.isVisited(ea)
+	seenB := p.isVisited(eb)
+	switch {
+	case seenA && seenB:
+		return bothVisited
+	case seenA || seenB:
+		return oneVisited
+	}
+
+	return noneVisited
+}
+
+func (p *printer) isVisited(v reflect.Value) bool {
+	key, ok := visitKeyFor(v)
+
+	return ok && p.visited[key]
+}
+
+func (p *printer) diffStruct(a, b reflect.Value, showType bool) {
+	t := a.Type()
+	if key, ok := visitKeyFor(a); ok {
+		p.visited[key] = true
+		defer delete(p.visited, key)
+	}
+	if key, ok := visitKeyFor(b); ok {
+		p.visited[key] = true
+		defer delete(p.visited, key)
+	}
+
+	if showType {
+		p.writeType(t)
+	}
+	writeByte(p, '{')
+	if !Nonzero(a) && !Nonzero(b) {
+		writeByte(p, '}')
+
+		return
+	}
+	writeByte(p, '\n')
+	pp := p.indent()
+	for i := 0; i < t.NumField(); i++ {
+		af, bf := getField(a, i), getField(b, i)
+		if pp.lazy && !Nonzero(af) && !Nonzero(bf) {
+			continue
+		}
+		name := t.Field(i).Name
+		showTypeInField := name != "" && labelType(t.Field(i).Type)
+		pp.diffNamed(name, af, bf, showTypeInField)
+	}
+	pp.tw.Flush()
+	writeByte(p, '}')
+}
+
+func (p *printer) diffMap(a, b reflect.Value, showType bool) {
+	t := a.Type()
+	if key, ok := visitKeyFor(a); ok {
+		p.visited[key] = true
+		defer delete(p.visited, key)
+	}
+	if key, ok := visitKeyFor(b); ok {
+		p.visited[key] = true
+		defer delete(p.visited, key)
+	}
+
+	if showType {
+		p.writeType(t)
+	}
+	writeByte(p, '{')
+	if a.Len() == 0 && b.Len() == 0 {
+		writeByte(p, '}')
+
+		return
+	}
+	writeByte(p, '\n')
+	pp := p.indent()
+	showTypeInEntry := t.Elem().Kind() == reflect.Interface
+	for _, k := range unionKeys(a, b) {
+		av, bv := a.MapIndex(k), b.MapIndex(k)
+		if av.IsValid() && bv.IsValid() && (equalValue(av, bv) || isCompositeKind(av.Kind())) {
+			pp.printValue(k, false, true)
+			writeByte(pp, ':')
+			writeByte(pp, '\t')
+			pp.diffValue(av, bv, showTypeInEntry)
+			io.WriteString(pp, ",\n")
+
+			continue
+		}
+
+		if av.IsValid() {
+			sub := pp.signedIndent('-')
+			sub.printValue(k, false, true)
+			writeByte(sub, ':')
+			writeByte(sub, '\t')
+			sub.printValue(av, showTypeInEntry, true)
+			io.WriteString(sub, ",\n")
+			sub.tw.Flush()
+		}
+		if bv.IsValid() {
+			sub := pp.signedIndent('+')
+			sub.printValue(k, false, true)
+			writeByte(sub, ':')
+			writeByte(sub, '\t')
+			sub.printValue(bv, showTypeInEntry, true)
+			io.WriteString(sub, ",\n")
+			sub.tw.Flush()
+		}
+	}
+	pp.tw.Flush()
+	writeByte(p, '}')
+}
+
+// unionKeys returns the keys present in a or b, in the same deterministic
+// order printValue uses for a single map. When the keys can be passed
+// through Value.Interface, they're deduped with a hash set as before; a map
+// reached through an unexported struct field carries read-only keys that
+// Interface would panic on, so those fall back to deduping with equalValue,
+// which works on unexported fields too.
+func unionKeys(a, b reflect.Value) []reflect.Value {
+	keys := a.MapKeys()
+	bkeys := b.MapKeys()
+
+	if a.CanInterface() && b.CanInterface() {
+		seen := make(map[interface{}]bool, len(keys))
+		for _, k := range keys {
+			seen[k.Interface()] = true
+		}
+		for _, k := range bkeys {
+			if !seen[k.Interface()] {
+				keys = append(keys, k)
+			}
+		}
+	} else {
+		for _, k := range bkeys {
+			dup := false
+			for _, ak := range keys {
+				if equalValue(ak, k) {
+					dup = true
+
+					break
+				}
+			}
+			if !dup {
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Sort(reflectValuesByOrder(keys))
+
+	return keys
+}
+
+func (p *printer) diffSlice(a, b reflect.Value, showType bool) {
+	t := a.Type()
+	if key, ok := visitKeyFor(a); ok {
+		p.visited[key] = true
+		defer delete(p.visited, key)
+	}
+	if key, ok := visitKeyFor(b); ok {
+		p.visited[key] = true
+		defer delete(p.visited, key)
+	}
+
+	if showType {
+		p.writeType(t)
+	}
+	if a.Kind() == reflect.Slice && a.IsNil() && b.Kind() == reflect.Slice && b.IsNil() {
+		io.WriteString(p, "(nil)")
+
+		return
+	}
+	writeByte(p, '{')
+	n := a.Len()
+	if b.Len() > n {
+		n = b.Len()
+	}
+	if n == 0 {
+		writeByte(p, '}')
+
+		return
+	}
+	writeByte(p, '\n')
+	pp := p.indent()
+	showTypeInElem := t.Elem().Kind() == reflect.Interface
+	for i := 0; i < n; i++ {
+		var av, bv reflect.Value
+		if i < a.Len() {
+			av = a.Index(i)
+		}
+		if i < b.Len() {
+			bv = b.Index(i)
+		}
+		pp.diffNamed("", av, bv, showTypeInElem)
+	}
+	pp.tw.Flush()
+	writeByte(p, '}')
+}
+
+// diffNamed prints one struct field or slice element, optionally preceded by
+// "name:\t", recursing when both sides are present and still structurally
+// comparable, otherwise printing the two sides signed "-"/"+".
+func (p *printer) diffNamed(name string, a, b reflect.Value, showType bool) {
+	if a.IsValid() && b.IsValid() && a.Type() == b.Type() && (equalValue(a, b) || isCompositeKind(a.Kind())) {
+		if name != "" {
+			io.WriteString(p, name)
+			writeByte(p, ':')
+			writeByte(p, '\t')
+		}
+		p.diffValue(a, b, showType)
+		io.WriteString(p, ",\n")
+
+		return
+	}
+
+	if a.IsValid() {
+		sub := p.signedIndent('-')
+		if name != "" {
+			io.WriteString(sub, name)
+			writeByte(sub, ':')
+			writeByte(sub, '\t')
+		}
+		sub.printValue(a, showType, true)
+		io.WriteString(sub, ",\n")
+		sub.tw.Flush()
+	}
+	if b.IsValid() {
+		sub := p.signedIndent('+')
+		if name != "" {
+			io.WriteString(sub, name)
+			writeByte(sub, ':')
+			writeByte(sub, '\t')
+		}
+		sub.printValue(b, showType, true)
+		io.WriteString(sub, ",\n")
+		sub.tw.Flush()
+	}
+}
+
+// equalPair identifies one (a, b) pointer/map/slice pair seen while
+// comparing two values, so equalValue can treat a repeat visit (a cycle in
+// a or b) as equal instead of recursing forever.
+type equalPair struct {
+	a, b uintptr
+	typ  reflect.Type
+}
+
+// equalValue reports whether a and b hold the same value. It is equivalent
+// to reflect.DeepEqual, but works on unexported struct fields too, which
+// cannot be passed through Value.Interface.
+func equalValue(a, b reflect.Value) bool {
+	return equalValueVisited(a, b, make(map[equalPair]bool))
+}
+
+// equalValueVisited is equalValue with a visited set threaded through the
+// recursion, much like reflect.DeepEqual does for cyclic data: a pointer,
+// map or slice reached again via the same (a, b) address pair while that
+// pair is still being compared further up the recursion is assumed equal
+// rather than walked again, so a self-referential a or b terminates instead
+// of recursing forever. A pair is forgotten once its comparison returns.
+func equalValueVisited(a, b reflect.Value, visited map[equalPair]bool) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if !a.IsNil() && !b.IsNil() {
+			pair := equalPair{a.Pointer(), b.Pointer(), a.Type()}
+			if visited[pair] {
+				return true
+			}
+			visited[pair] = true
+			defer delete(visited, pair)
+		}
+	}
+
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Array:
+		for i := 0; i < a.Len(); i++ {
+			if !equalValueVisited(a.Index(i), b.Index(i), visited) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !equalValueVisited(a.Field(i), b.Field(i), visited) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.Slice:
+		if a.IsNil() != b.IsNil() || a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equalValueVisited(a.Index(i), b.Index(i), visited) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.Map:
+		if a.IsNil() != b.IsNil() || a.Len() != b.Len() {
+			return false
+		}
+		for _, k := range a.MapKeys() {
+			bv := b.MapIndex(k)
+			if !bv.IsValid() || !equalValueVisited(a.MapIndex(k), bv, visited) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+
+		return equalValueVisited(a.Elem(), b.Elem(), visited)
+	case reflect.Chan, reflect.UnsafePointer:
+		return a.Pointer() == b.Pointer()
+	case reflect.Func:
+		return a.IsNil() && b.IsNil()
+	}
+
+	return true
+}
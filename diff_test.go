@@ -0,0 +1,149 @@
+package pretty
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type diffTest struct {
+	a, b interface{}
+	s    string
+}
+
+var diffs = []diffTest{
+	{1, 1, "int(1)"},
+	{1, 2, "- int(1)\n+ int(2)\n"},
+	{
+		T{x: 1, y: 2},
+		T{x: 1, y: 3},
+		"pretty.T{\n    x:  1,\n    - y: 2,\n    + y: 3,\n}",
+	},
+	{
+		[]int{1, 2, 3},
+		[]int{1, 2},
+		"[]int{\n    1,\n    2,\n    - 3,\n}",
+	},
+	{
+		map[string]int{"a": 1, "b": 2},
+		map[string]int{"a": 1, "c": 3},
+		"map[string]int{\n    \"a\": 1,\n    - \"b\": 2,\n    + \"c\": 3,\n}",
+	},
+	{
+		&T{x: 1, y: 2},
+		(*T)(nil),
+		"- &pretty.T{x:1, y:2}\n+ nil\n",
+	},
+}
+
+func TestDiff(t *testing.T) {
+	for _, tt := range diffs {
+		s := Diff(tt.a, tt.b)
+		if s != tt.s {
+			t.Errorf("Diff(%#v, %#v):\nexpected %q\ngot      %q", tt.a, tt.b, tt.s, s)
+		}
+	}
+}
+
+type cycA struct {
+	N    int
+	Self *cycA
+}
+
+func TestDiffCycle(t *testing.T) {
+	a := &cycA{N: 1}
+	a.Self = a
+	b := &cycA{N: 1}
+	b.Self = b
+
+	// panics from stack overflow without cycle detection
+	t.Logf("Example equal cycle:\n%s", Diff(a, b))
+
+	b.N = 2
+	t.Logf("Example differing cycle:\n%s", Diff(a, b))
+}
+
+type withUnexportedMap struct {
+	m map[string]int
+}
+
+func TestDiffUnexportedMap(t *testing.T) {
+	a := withUnexportedMap{m: map[string]int{"a": 1, "b": 2}}
+	b := withUnexportedMap{m: map[string]int{"a": 1, "c": 3}}
+
+	s := Diff(a, b)
+	if strings.Contains(s, "PANIC") {
+		t.Errorf("diffing a map reached through an unexported field panicked:\n%s", s)
+	}
+}
+
+type cycNode struct {
+	N    int
+	Next *cycNode
+}
+
+// TestDiffAsymmetricCycle covers a only looping back on itself while b is a
+// genuinely different, non-cyclic value: the cyclic side should collapse to
+// a marker, but b's own content must still be shown rather than being
+// silently dropped by the cycle guard.
+func TestDiffAsymmetricCycle(t *testing.T) {
+	a := &cycNode{N: 1}
+	a.Next = a
+
+	b := &cycNode{N: 1, Next: &cycNode{N: 2}}
+
+	s := Diff(a, b)
+	if !strings.Contains(s, "CYCLIC REFERENCE") || !strings.Contains(s, "N:    2,") {
+		t.Errorf("expected a's cyclic marker alongside b's full, non-cyclic subtree, got:\n%s", s)
+	}
+}
+
+// TestDiffMapCycle covers self-referential maps in both operands, including
+// when they differ elsewhere: diffMap used to have no cycle protection of
+// its own and would recurse forever once the equal-value fast path no
+// longer applied.
+func TestDiffMapCycle(t *testing.T) {
+	a := map[string]interface{}{"n": 1}
+	a["self"] = a
+	b := map[string]interface{}{"n": 1}
+	b["self"] = b
+
+	// panics from stack overflow without cycle detection
+	t.Logf("Example equal cyclic map:\n%s", Diff(a, b))
+
+	b["n"] = 2
+	s := Diff(a, b)
+	if !strings.Contains(s, "CYCLIC REFERENCE") {
+		t.Errorf("expected differing cyclic maps to still report a cyclic reference, got:\n%s", s)
+	}
+	t.Logf("Example differing cyclic map:\n%s", s)
+}
+
+// TestDiffSliceCycle is TestDiffMapCycle's slice counterpart; diffSlice had
+// the same missing cycle protection as diffMap.
+func TestDiffSliceCycle(t *testing.T) {
+	a := make([]interface{}, 2)
+	a[0] = 1
+	a[1] = a
+
+	b := make([]interface{}, 2)
+	b[0] = 2
+	b[1] = b
+
+	s := Diff(a, b)
+	if !strings.Contains(s, "CYCLIC REFERENCE") {
+		t.Errorf("expected differing cyclic slices to still report a cyclic reference, got:\n%s", s)
+	}
+}
+
+func TestEqualValueMapCycle(t *testing.T) {
+	a := map[string]interface{}{"n": 1}
+	a["self"] = a
+	b := map[string]interface{}{"n": 1}
+	b["self"] = b
+
+	// panics from stack overflow without cycle detection
+	if !equalValue(reflect.ValueOf(a), reflect.ValueOf(b)) {
+		t.Errorf("equalValue(%v, %v) = false, want true", a, b)
+	}
+}
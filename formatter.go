@@ -1,8 +1,10 @@
 package pretty
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"sort"
 	"strconv"
@@ -14,11 +16,78 @@ import (
 
 var ConvertErrorStringObject bool = false
 
+// Config customizes how a value is turned into Go source by a formatter.
+// A zero Config formats like the package-level Formatter, except that the
+// package-level ConvertErrorStringObject variable and the built-in
+// never-inline and package-rewrite rules are not applied; Config fields
+// take their place.
+type Config struct {
+	// TypeFormatters overrides the default formatting for a type. The
+	// function's return value is written verbatim, in place of whatever
+	// printValue would otherwise produce for that value.
+	TypeFormatters map[reflect.Type]func(reflect.Value) string
+
+	// PackageAliases rewrites the package qualifier written for a type,
+	// keyed by the type's import path. Types whose import path is not
+	// present are qualified with their usual short package name.
+	PackageAliases map[string]string
+
+	// SourcePackage is the import path of the package the formatted source
+	// is meant to compile in. When set, types declared in SourcePackage are
+	// written unqualified instead of with their package name, so the
+	// output is valid Go source for that package. See Config.SourceFormatter.
+	SourcePackage string
+
+	// NeverInline lists types that are always expanded onto multiple
+	// lines, even when they would otherwise fit on one.
+	NeverInline map[reflect.Type]bool
+
+	// ConvertErrorStringObject renders a *errors.errorString as a call to
+	// errors.New instead of expanding its unexported field.
+	ConvertErrorStringObject bool
+
+	// Lazy omits struct fields and map entries that hold a zero value.
+	Lazy bool
+
+	// IndentWidth is the number of columns each nesting level is indented
+	// by. Zero uses the package default of 4.
+	IndentWidth int
+
+	// UseSpaces indents with IndentWidth spaces instead of a tab character.
+	UseSpaces bool
+
+	// MaxDepth limits how many levels of nested structs, maps,
+	// slices/arrays, pointers and interfaces are expanded before being
+	// truncated with "…". Zero means unlimited.
+	MaxDepth int
+
+	// MaxSliceElements limits how many elements of a slice or array are
+	// printed before the rest are collapsed into a "/* N more */" marker.
+	// Zero means unlimited.
+	MaxSliceElements int
+
+	// MaxMapEntries limits how many map entries are printed before the
+	// rest are collapsed into a "/* N more */" marker. Zero means
+	// unlimited.
+	MaxMapEntries int
+
+	// MaxStringBytes limits how many bytes of a string are printed before
+	// it is truncated with "…". Zero means unlimited.
+	MaxStringBytes int
+
+	// MaxBytesInline limits how many bytes of a []byte are included in its
+	// quoted form, either the []uint8("...") literal or the trailing
+	// "/* ... */" comment, before being truncated with "…". Zero means
+	// unlimited.
+	MaxBytesInline int
+}
+
 type formatter struct {
 	v     reflect.Value
 	force bool
 	quote bool
 	lazy  bool
+	cfg   *Config
 }
 
 // Formatter makes a wrapper, f, that will format x as go source with line
@@ -39,6 +108,58 @@ func LazyFormatter(x interface{}) (f fmt.Formatter) {
 	return formatter{v: reflect.ValueOf(x), quote: true, lazy: true}
 }
 
+// Formatter works like the package-level Formatter, but uses cfg to drive
+// per-type formatters, package aliasing, inlining and layout decisions.
+func (cfg Config) Formatter(x interface{}) (f fmt.Formatter) {
+	return formatter{v: reflect.ValueOf(x), quote: true, lazy: cfg.Lazy, cfg: &cfg}
+}
+
+// SourceFormatter works like Config.Formatter, but qualifies type names so
+// the output compiles as source inside pkgPath: types declared in pkgPath
+// are written unqualified, and every other package of a named type it writes
+// is recorded so it can be retrieved with Imports after formatting. Unnamed
+// types, such as struct { X T }, are written as reflect spells them: the
+// types inside them are neither requalified nor recorded.
+func (cfg Config) SourceFormatter(x interface{}, pkgPath string) *SourceFormat {
+	cfg.SourcePackage = pkgPath
+
+	return &SourceFormat{fo: formatter{v: reflect.ValueOf(x), quote: true, lazy: cfg.Lazy, cfg: &cfg}}
+}
+
+// SourceFormat is the fmt.Formatter returned by Config.SourceFormatter. It
+// additionally tracks which packages were referenced by the most recent
+// Format call.
+type SourceFormat struct {
+	fo      formatter
+	imports map[string]bool
+}
+
+func (s *SourceFormat) Format(f fmt.State, c rune) {
+	if s.fo.force || c == 'v' && f.Flag('#') && f.Flag(' ') {
+		w := newTabWriter(f, s.fo.cfg)
+		imports := make(map[string]bool)
+		p := &printer{tw: w, Writer: w, visited: make(map[visit]bool), lazy: s.fo.lazy, cfg: s.fo.cfg, imports: imports}
+		p.printValue(s.fo.v, true, s.fo.quote)
+		w.Flush()
+		s.imports = imports
+
+		return
+	}
+	s.fo.passThrough(f, c)
+}
+
+// Imports reports the import paths referenced by the most recent Format
+// call, sorted.
+func (s *SourceFormat) Imports() []string {
+	imports := make([]string, 0, len(s.imports))
+	for pkg := range s.imports {
+		imports = append(imports, pkg)
+	}
+	sort.Strings(imports)
+
+	return imports
+}
+
 func (fo formatter) String() string {
 	return fmt.Sprint(fo.v) // unwrap it
 }
@@ -62,8 +183,8 @@ func (fo formatter) passThrough(f fmt.State, c rune) {
 
 func (fo formatter) Format(f fmt.State, c rune) {
 	if fo.force || c == 'v' && f.Flag('#') && f.Flag(' ') {
-		w := tabwriter.NewWriter(f, 4, 4, 1, ' ', 0)
-		p := &printer{tw: w, Writer: w, visited: make(map[visit]int), lazy: fo.lazy}
+		w := newTabWriter(f, fo.cfg)
+		p := &printer{tw: w, Writer: w, visited: make(map[visit]bool), lazy: fo.lazy, cfg: fo.cfg}
 		p.printValue(fo.v, true, fo.quote)
 		w.Flush()
 		return
@@ -71,21 +192,51 @@ func (fo formatter) Format(f fmt.State, c rune) {
 	fo.passThrough(f, c)
 }
 
+// newTabWriter builds the tabwriter used to lay out one nesting level,
+// honoring cfg.IndentWidth when set. cfg may be nil.
+func newTabWriter(w io.Writer, cfg *Config) *tabwriter.Writer {
+	width := 4
+	if cfg != nil && cfg.IndentWidth > 0 {
+		width = cfg.IndentWidth
+	}
+	return tabwriter.NewWriter(w, width, width, 1, ' ', 0)
+}
+
 type printer struct {
 	io.Writer
 	tw      *tabwriter.Writer
-	visited map[visit]int
+	visited map[visit]bool
 	depth   int
 	lazy    bool
+	cfg     *Config
+
+	// imports collects the import paths of types written by writeType,
+	// when cfg.SourcePackage is set. Nil outside of SourceFormat.Format.
+	imports map[string]bool
 }
 
 func (p *printer) indent() *printer {
 	q := *p
-	q.tw = tabwriter.NewWriter(p.Writer, 4, 4, 1, ' ', 0)
-	q.Writer = text.NewIndentWriter(q.tw, []byte{'\t'})
+	q.tw = newTabWriter(p.Writer, p.cfg)
+	q.Writer = text.NewIndentWriter(q.tw, p.indentBytes())
+	q.depth++
 	return &q
 }
 
+// indentBytes returns the bytes written for one nesting level of
+// indentation: a single tab by default, or cfg.IndentWidth spaces when
+// cfg.UseSpaces is set.
+func (p *printer) indentBytes() []byte {
+	if p.cfg != nil && p.cfg.UseSpaces {
+		width := p.cfg.IndentWidth
+		if width == 0 {
+			width = 4
+		}
+		return bytes.Repeat([]byte{' '}, width)
+	}
+	return []byte{'\t'}
+}
+
 func (p *printer) printInline(v reflect.Value, x interface{}, showType bool) {
 	if showType {
 		p.writeType(v.Type())
@@ -102,42 +253,174 @@ type visit struct {
 	typ reflect.Type
 }
 
+// visitKeyFor returns the visit key identifying v for cyclic-reference
+// tracking, for the reflect kinds that can form cycles: Ptr/Map/Slice via
+// their runtime address, Struct/Array via the address of an addressable
+// value. ok is false when v's kind or addressability rules out tracking it.
+func visitKeyFor(v reflect.Value) (key visit, ok bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return visit{}, false
+		}
+		addr := v.Pointer()
+		if v.Kind() == reflect.Slice {
+			// Distinct slices can share a backing array's address (e.g. a
+			// sub-slice), so fold the length in too: same address alone
+			// doesn't mean v is the same slice value seen higher up.
+			addr = addr*31 + uintptr(v.Len())
+		}
+
+		return visit{addr, v.Type()}, true
+	case reflect.Struct, reflect.Array:
+		if !v.CanAddr() {
+			return visit{}, false
+		}
+
+		return visit{v.UnsafeAddr(), v.Type()}, true
+	}
+
+	return visit{}, false
+}
+
+// enterVisit marks v as currently being printed. It reports whether v was
+// already being printed higher up the call stack (a cycle), along with an
+// unmark func to call once printing v's contents has finished; unmark is nil
+// when v isn't a kind visitKeyFor can track or already reported a cycle.
+func (p *printer) enterVisit(v reflect.Value) (cyclic bool, unmark func()) {
+	key, ok := visitKeyFor(v)
+	if !ok {
+		return false, nil
+	}
+
+	if p.visited[key] {
+		return true, nil
+	}
+	p.visited[key] = true
+
+	return false, func() { delete(p.visited, key) }
+}
+
 type reflectValuesByOrder []reflect.Value
 
 func (s reflectValuesByOrder) Len() int      { return len(s) }
 func (s reflectValuesByOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// Less defines a deterministic total order over map keys, along the lines of
+// go-cmp's value.SortKeys: values that implement String are ordered by that
+// result (as before), everything else is ordered by kind-specific comparisons
+// rather than reflect's "<T Value>" placeholder.
 func (s reflectValuesByOrder) Less(i, j int) bool {
-	si := stringValue(s[i])
-	sj := stringValue(s[j])
+	return isLess(s[i], s[j])
+}
 
-	if si != sj {
-		if si < sj {
-			return true
+func isLess(x, y reflect.Value) bool {
+	if sx, ok := stringerValue(x); ok {
+		if sy, ok := stringerValue(y); ok {
+			return sx < sy
+		}
+	}
+
+	if x.Kind() != y.Kind() {
+		return x.Kind().String() < y.Kind().String()
+	}
+
+	switch x.Kind() {
+	case reflect.Bool:
+		return !x.Bool() && y.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return x.Int() < y.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return x.Uint() < y.Uint()
+	case reflect.Float32, reflect.Float64:
+		return lessFloat(x.Float(), y.Float())
+	case reflect.Complex64, reflect.Complex128:
+		cx, cy := x.Complex(), y.Complex()
+		if kxr, kyr := floatKey(real(cx)), floatKey(real(cy)); kxr != kyr {
+			return kxr < kyr
+		}
+
+		return floatKey(imag(cx)) < floatKey(imag(cy))
+	case reflect.String:
+		return x.String() < y.String()
+	case reflect.Array:
+		for i := 0; i < x.Len(); i++ {
+			if isLess(x.Index(i), y.Index(i)) {
+				return true
+			}
+			if isLess(y.Index(i), x.Index(i)) {
+				return false
+			}
 		}
 
 		return false
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			if isLess(x.Field(i), y.Field(i)) {
+				return true
+			}
+			if isLess(y.Field(i), x.Field(i)) {
+				return false
+			}
+		}
+
+		return false
+	case reflect.Chan, reflect.UnsafePointer, reflect.Ptr:
+		return x.Pointer() < y.Pointer()
+	case reflect.Interface:
+		ex, ey := x.Elem(), y.Elem()
+		if !ex.IsValid() || !ey.IsValid() {
+			return ex.IsValid() && !ey.IsValid()
+		}
+		if tx, ty := ex.Type(), ey.Type(); tx != ty {
+			return tx.String() < ty.String()
+		}
+
+		return isLess(ex, ey)
 	}
 
 	return false
 }
 
-func stringValue(v reflect.Value) string {
+// stringerValue returns v's String method result when v implements
+// fmt.Stringer, so types with a meaningful String method keep sorting by it
+// rather than by their underlying representation.
+func stringerValue(v reflect.Value) (string, bool) {
 	stringMethod := v.MethodByName("String")
-	if stringMethod.IsValid() {
-		returnValues := stringMethod.Call(nil)
-		if len(returnValues) == 1 && returnValues[0].IsValid() {
-			return returnValues[0].String()
-		}
+	if !stringMethod.IsValid() {
+		return "", false
 	}
+	returnValues := stringMethod.Call(nil)
+	if len(returnValues) != 1 || !returnValues[0].IsValid() {
+		return "", false
+	}
+
+	return returnValues[0].String(), true
+}
+
+// floatKey maps f onto a uint64 that preserves float ordering when compared
+// numerically, with NaN sorted last.
+func floatKey(f float64) uint64 {
+	if math.IsNaN(f) {
+		return math.MaxUint64
+	}
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		return ^bits
+	}
+
+	return bits | 1<<63
+}
 
-	return v.String()
+func lessFloat(x, y float64) bool {
+	return floatKey(x) < floatKey(y)
 }
 
 func (p *printer) writeType(t reflect.Type) {
 	switch t.Kind() {
 	case reflect.Array:
 		io.WriteString(p, "[")
-		io.WriteString(p, string(t.Len()))
+		io.WriteString(p, strconv.Itoa(t.Len()))
 		io.WriteString(p, "]")
 		p.writeType(t.Elem())
 	case reflect.Chan:
@@ -155,10 +438,41 @@ func (p *printer) writeType(t reflect.Type) {
 		io.WriteString(p, "[]")
 		p.writeType(t.Elem())
 	default:
-		switch t.PkgPath() {
-		// TODO We want to respect all our custom imports. https://gitlab.nethead.at/symflower/symflower/-/issues/203
-		case "gitlab.nethead.at/symflower/symflower/model/ast", "gitlab.nethead.at/symflower/symflower/model/errors":
-			io.WriteString(p, "model")
+		pkgPath := t.PkgPath()
+		if pkgPath != "" && p.cfg != nil && p.cfg.SourcePackage != "" {
+			if pkgPath == p.cfg.SourcePackage {
+				io.WriteString(p, t.Name())
+
+				return
+			}
+			if p.imports != nil {
+				p.imports[pkgPath] = true
+			}
+			if alias, ok := p.cfg.PackageAliases[pkgPath]; ok && alias != "" {
+				io.WriteString(p, alias)
+				io.WriteString(p, ".")
+				io.WriteString(p, t.Name())
+
+				return
+			}
+			io.WriteString(p, t.String())
+
+			return
+		}
+		if p.cfg != nil {
+			if alias, ok := p.cfg.PackageAliases[pkgPath]; ok && alias != "" {
+				io.WriteString(p, alias)
+				io.WriteString(p, ".")
+				io.WriteString(p, t.Name())
+
+				return
+			}
+		} else {
+			switch pkgPath {
+			// TODO We want to respect all our custom imports. https://gitlab.nethead.at/symflower/symflower/-/issues/203
+			case "gitlab.nethead.at/symflower/symflower/model/ast", "gitlab.nethead.at/symflower/symflower/model/errors":
+				io.WriteString(p, "model")
+			}
 		}
 		io.WriteString(p, t.String())
 	}
@@ -171,6 +485,23 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 		return
 	}
 
+	if p.cfg != nil {
+		if fn, ok := p.cfg.TypeFormatters[v.Type()]; ok {
+			io.WriteString(p, fn(v))
+
+			return
+		}
+	}
+
+	if p.cfg != nil && p.cfg.MaxDepth > 0 && p.depth > p.cfg.MaxDepth && isCompositeKind(v.Kind()) {
+		if showType {
+			p.writeType(v.Type())
+		}
+		io.WriteString(p, "…")
+
+		return
+	}
+
 	stringGoMethod := v.MethodByName("StringGo")
 	if stringGoMethod.IsValid() {
 		isPointerType := v.Type().Kind() == reflect.Pointer
@@ -195,7 +526,11 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 	case reflect.Complex64, reflect.Complex128:
 		fmt.Fprintf(p, "%#v", v.Complex())
 	case reflect.String:
-		p.fmtString(v.String(), quote)
+		s := v.String()
+		if p.cfg != nil && p.cfg.MaxStringBytes > 0 && len(s) > p.cfg.MaxStringBytes {
+			s = truncateString(s, p.cfg.MaxStringBytes) + "…"
+		}
+		p.fmtString(s, quote)
 	case reflect.Map:
 		if v.IsNil() {
 			io.WriteString(p, "nil")
@@ -203,12 +538,19 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 			return
 		}
 		t := v.Type()
+		if cyclic, unmark := p.enterVisit(v); cyclic {
+			p.fmtString(t.String()+"{(CYCLIC REFERENCE)}", false)
+
+			return
+		} else if unmark != nil {
+			defer unmark()
+		}
 		if showType {
 			p.writeType(t)
 		}
 		writeByte(p, '{')
 		if Nonzero(v) {
-			expand := !canInline(v.Type())
+			expand := !p.canInline(v.Type())
 			pp := p
 			if expand {
 				writeByte(p, '\n')
@@ -216,10 +558,22 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 			}
 			keys := v.MapKeys()
 			sort.Sort(reflectValuesByOrder(keys))
-			for i := 0; i < v.Len(); i++ {
+			shown := len(keys)
+			if p.cfg != nil && p.cfg.MaxMapEntries > 0 && p.cfg.MaxMapEntries < shown {
+				shown = p.cfg.MaxMapEntries
+			}
+			printed := 0
+			for i := 0; i < shown; i++ {
 				showTypeInStruct := true
 				k := keys[i]
 				mv := v.MapIndex(k)
+				if pp.lazy && !Nonzero(mv) {
+					continue
+				}
+				if !expand && printed > 0 {
+					io.WriteString(pp, ", ")
+				}
+				printed++
 				pp.printValue(k, false, true)
 				writeByte(pp, ':')
 				if expand {
@@ -229,9 +583,13 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 				pp.printValue(mv, showTypeInStruct, true)
 				if expand {
 					io.WriteString(pp, ",\n")
-				} else if i < v.Len()-1 {
+				}
+			}
+			if shown < len(keys) {
+				if !expand && printed > 0 {
 					io.WriteString(pp, ", ")
 				}
+				pp.writeTruncatedMore(len(keys)-shown, expand)
 			}
 			if expand {
 				pp.tw.Flush()
@@ -240,14 +598,11 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 		writeByte(p, '}')
 	case reflect.Struct:
 		t := v.Type()
-		if v.CanAddr() {
-			addr := v.UnsafeAddr()
-			vis := visit{addr, t}
-			if vd, ok := p.visited[vis]; ok && vd < p.depth && p.depth > 40 {
-				p.fmtString(t.String()+"{(CYCLIC REFERENCE)}", false)
-				break // don't print v again
-			}
-			p.visited[vis] = p.depth
+		if cyclic, unmark := p.enterVisit(v); cyclic {
+			p.fmtString(t.String()+"{(CYCLIC REFERENCE)}", false)
+			break // don't print v again
+		} else if unmark != nil {
+			defer unmark()
 		}
 
 		if showType {
@@ -255,17 +610,22 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 		}
 		writeByte(p, '{')
 		if Nonzero(v) {
-			expand := !canInline(v.Type())
+			expand := !p.canInline(v.Type())
 			pp := p
 			if expand {
 				writeByte(p, '\n')
 				pp = p.indent()
 			}
+			printed := 0
 			for i := 0; i < v.NumField(); i++ {
 				showTypeInStruct := true
 				if p.lazy && !Nonzero(v.Field(i)) {
 					continue
 				}
+				if !expand && printed > 0 {
+					io.WriteString(pp, ", ")
+				}
+				printed++
 				if f := t.Field(i); f.Name != "" {
 					io.WriteString(pp, f.Name)
 					writeByte(pp, ':')
@@ -277,8 +637,6 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 				pp.printValue(getField(v, i), showTypeInStruct, true)
 				if expand {
 					io.WriteString(pp, ",\n")
-				} else if i < v.NumField()-1 {
-					io.WriteString(pp, ", ")
 				}
 			}
 			if expand {
@@ -314,19 +672,30 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 
 		if t.Elem().Kind() == reflect.Uint8 && utf8.Valid(v.Bytes()) {
 			writeByte(p, '(')
-			io.WriteString(p, strconv.Quote(string(v.Bytes())))
+			io.WriteString(p, strconv.Quote(p.truncateBytesInline(v.Bytes())))
 			writeByte(p, ')')
 			break
 		}
 
+		if cyclic, unmark := p.enterVisit(v); cyclic {
+			io.WriteString(p, "{(CYCLIC REFERENCE)}")
+			break
+		} else if unmark != nil {
+			defer unmark()
+		}
+
 		writeByte(p, '{')
-		expand := !canInline(v.Type())
+		expand := !p.canInline(v.Type())
 		pp := p
 		if expand {
 			writeByte(p, '\n')
 			pp = p.indent()
 		}
-		for i := 0; i < v.Len(); i++ {
+		shown := v.Len()
+		if p.cfg != nil && p.cfg.MaxSliceElements > 0 && p.cfg.MaxSliceElements < shown {
+			shown = p.cfg.MaxSliceElements
+		}
+		for i := 0; i < shown; i++ {
 			showTypeInSlice := t.Elem().Kind() == reflect.Interface
 			pp.printValue(v.Index(i), showTypeInSlice, true)
 			if expand {
@@ -335,6 +704,9 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 				io.WriteString(pp, ", ")
 			}
 		}
+		if shown < v.Len() {
+			pp.writeTruncatedMore(v.Len()-shown, expand)
+		}
 		if expand {
 			pp.tw.Flush()
 		}
@@ -342,7 +714,7 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 		if t.Elem().Kind() == reflect.Uint8 {
 			writeByte(p, ' ')
 			io.WriteString(p, "/* ")
-			io.WriteString(pp, strconv.Quote(string(v.Bytes())))
+			io.WriteString(pp, strconv.Quote(p.truncateBytesInline(v.Bytes())))
 			io.WriteString(p, " */")
 		}
 	case reflect.Ptr:
@@ -351,8 +723,18 @@ func (p *printer) printValue(v reflect.Value, showType, quote bool) {
 			writeByte(p, '(')
 			io.WriteString(p, v.Type().String())
 			io.WriteString(p, ")(nil)")
+		} else if cyclic, unmark := p.enterVisit(v); cyclic {
+			writeByte(p, '&')
+			p.fmtString(e.Type().String()+"{(CYCLIC REFERENCE)}", false)
 		} else {
-			if ConvertErrorStringObject && e.Type().PkgPath() == "errors" && e.Type().Name() == "errorString" {
+			if unmark != nil {
+				defer unmark()
+			}
+			convertErrorStringObject := ConvertErrorStringObject
+			if p.cfg != nil {
+				convertErrorStringObject = p.cfg.ConvertErrorStringObject
+			}
+			if convertErrorStringObject && e.Type().PkgPath() == "errors" && e.Type().Name() == "errorString" {
 				p.fmtString("errors.New(", false)
 				p.printValue(e.FieldByName("s"), false, true)
 				p.fmtString(")", false)
@@ -413,8 +795,12 @@ var neverInlinedTypeNames = map[string]bool{
 	"gitlab.nethead.at/symflower/symflower/model/metrics.Symbol": true,
 }
 
-func canInline(t reflect.Type) bool {
-	if neverInlinedTypeNames[t.PkgPath()+"."+t.Name()] {
+func (p *printer) canInline(t reflect.Type) bool {
+	if p.cfg != nil {
+		if p.cfg.NeverInline[t] {
+			return false
+		}
+	} else if neverInlinedTypeNames[t.PkgPath()+"."+t.Name()] {
 		return false
 	}
 
@@ -450,6 +836,57 @@ func canExpand(t reflect.Type) bool {
 	return false
 }
 
+// isCompositeKind reports whether k is a kind that printValue can expand
+// into nested output, and so is subject to Config.MaxDepth truncation.
+func isCompositeKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Struct, reflect.Map, reflect.Array, reflect.Slice, reflect.Ptr, reflect.Interface:
+		return true
+	}
+
+	return false
+}
+
+// writeTruncatedMore writes a "/* N more */" marker for the n elements or
+// entries that Config.MaxSliceElements/MaxMapEntries held back, followed by
+// a newline when expand is set and by nothing otherwise.
+func (p *printer) writeTruncatedMore(n int, expand bool) {
+	if expand {
+		fmt.Fprintf(p, "/* %d more */\n", n)
+	} else {
+		fmt.Fprintf(p, "/* %d more */", n)
+	}
+}
+
+// truncateBytesInline applies Config.MaxBytesInline to bs, appending "…" when
+// truncated. p.cfg may be nil.
+func (p *printer) truncateBytesInline(bs []byte) string {
+	s := string(bs)
+	if p.cfg != nil && p.cfg.MaxBytesInline > 0 && len(s) > p.cfg.MaxBytesInline {
+		return truncateString(s, p.cfg.MaxBytesInline) + "…"
+	}
+
+	return s
+}
+
+// truncateString cuts s down to at most max bytes, backing off to the
+// nearest rune boundary so the result is still valid UTF-8.
+func truncateString(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	s = s[:max]
+	for len(s) > 0 {
+		r, size := utf8.DecodeLastRuneInString(s)
+		if r != utf8.RuneError || size != 1 {
+			break
+		}
+		s = s[:len(s)-1]
+	}
+
+	return s
+}
+
 func labelType(t reflect.Type) bool {
 	switch t.Kind() {
 	case reflect.Array, reflect.Interface, reflect.Map, reflect.Slice, reflect.Struct:
@@ -1,8 +1,10 @@
 package pretty
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"sort"
 	"strconv"
@@ -263,6 +265,25 @@ func TestCycle(t *testing.T) {
 	t.Logf("Example long interface cycle:\n%# v", Formatter(i))
 }
 
+// TestCycleMapSlice covers self-referential maps and slices, which used to
+// crash with an unrecoverable stack overflow because printValue only tracked
+// already-visited addressable structs, not maps or slices.
+func TestCycleMapSlice(t *testing.T) {
+	m := map[string]interface{}{"n": 1}
+	m["self"] = m
+	s := fmt.Sprintf("%# v", Formatter(m))
+	if !strings.Contains(s, "CYCLIC REFERENCE") {
+		t.Errorf("expected cyclic map to be caught, got:\n%s", s)
+	}
+
+	sl := make([]interface{}, 1)
+	sl[0] = sl
+	s = fmt.Sprintf("%# v", Formatter(sl))
+	if !strings.Contains(s, "CYCLIC REFERENCE") {
+		t.Errorf("expected cyclic slice to be caught, got:\n%s", s)
+	}
+}
+
 type TestStringer struct {
 	ordinal int
 }
@@ -320,7 +341,23 @@ func TestReflectValuesByOrderLess(t *testing.T) {
 
 		Values: []any{uint(1), 2},
 
-		SortOrderIndices: []uint{1, 0}, // The "<int Value>" is lexicographically lower than "<uint Value>" so it's sorted first.
+		SortOrderIndices: []uint{1, 0}, // Differing kinds are bucketed by kind name, and "int" sorts before "uint".
+	})
+
+	validate(t, &testCase{
+		Name: "Float Types",
+
+		Values: []any{math.Inf(1), 1.0, -1.0, math.Inf(-1)},
+
+		SortOrderIndices: []uint{3, 2, 1, 0}, // Ordered numerically, including the infinities.
+	})
+
+	validate(t, &testCase{
+		Name: "Struct Types",
+
+		Values: []any{T{x: 2, y: 0}, T{x: 1, y: 5}, T{x: 1, y: 0}},
+
+		SortOrderIndices: []uint{2, 1, 0}, // Structs are ordered field by field, not by their whole string representation.
 	})
 
 	validate(t, &testCase{
@@ -341,3 +378,177 @@ func TestReflectValuesByOrderLess(t *testing.T) {
 		SortOrderIndices: []uint{2, 1, 0}, // If the type has a "String" method, that one's result is used for sorting.
 	})
 }
+
+func TestTruncation(t *testing.T) {
+	t.Run("MaxDepth", func(t *testing.T) {
+		cfg := Config{MaxDepth: 1}
+		s := fmt.Sprintf("%# v", cfg.Formatter(SA{&T{1, 2}, T{3, 4}}))
+		want := `pretty.SA{
+    t:  &pretty.T…,
+    v:  pretty.T{x:3, y:4},
+}`
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+	})
+
+	t.Run("MaxSliceElements", func(t *testing.T) {
+		cfg := Config{MaxSliceElements: 2}
+		s := fmt.Sprintf("%# v", cfg.Formatter([]int{1, 2, 3, 4}))
+		want := "[]int{1, 2, /* 2 more */}"
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+	})
+
+	t.Run("MaxMapEntries", func(t *testing.T) {
+		cfg := Config{MaxMapEntries: 1}
+		s := fmt.Sprintf("%# v", cfg.Formatter(map[int]int{1: 1, 2: 2}))
+		want := "map[int]int{1:1, /* 1 more */}"
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+	})
+
+	t.Run("MaxStringBytes", func(t *testing.T) {
+		cfg := Config{MaxStringBytes: 5}
+		s := fmt.Sprintf("%# v", cfg.Formatter(long))
+		want := `"abcde…"`
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+	})
+
+	t.Run("MaxBytesInline", func(t *testing.T) {
+		cfg := Config{MaxBytesInline: 2}
+		s := fmt.Sprintf("%# v", cfg.Formatter([]byte("abc")))
+		want := `[]uint8("ab…")`
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+	})
+}
+
+func TestArrayLength(t *testing.T) {
+	s := fmt.Sprintf("%# v", Formatter([3]int{1, 2, 3}))
+	want := "[3]int{1, 2, 3}"
+	if s != want {
+		t.Errorf("expected %q\ngot      %q", want, s)
+	}
+}
+
+func TestSourceFormatter(t *testing.T) {
+	pkgPath := reflect.TypeOf(T{}).PkgPath()
+
+	t.Run("same package is unqualified", func(t *testing.T) {
+		sf := Config{}.SourceFormatter(T{1, 2}, pkgPath)
+		s := fmt.Sprintf("%# v", sf)
+		want := "T{x:1, y:2}"
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+		if imports := sf.Imports(); len(imports) != 0 {
+			t.Errorf("expected no imports, got %v", imports)
+		}
+	})
+
+	t.Run("other package is qualified and recorded", func(t *testing.T) {
+		sf := Config{}.SourceFormatter(T{1, 2}, "other/pkg")
+		s := fmt.Sprintf("%# v", sf)
+		want := "pretty.T{x:1, y:2}"
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+		want2 := []string{pkgPath}
+		if imports := sf.Imports(); !reflect.DeepEqual(imports, want2) {
+			t.Errorf("expected imports %v, got %v", want2, imports)
+		}
+	})
+
+	t.Run("PackageAliases is honored", func(t *testing.T) {
+		cfg := Config{PackageAliases: map[string]string{pkgPath: "pp"}}
+		sf := cfg.SourceFormatter(T{1, 2}, "other/pkg")
+		s := fmt.Sprintf("%# v", sf)
+		want := "pp.T{x:1, y:2}"
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+	})
+}
+
+func TestConfigLazy(t *testing.T) {
+	t.Run("struct fields", func(t *testing.T) {
+		s := fmt.Sprintf("%# v", Config{Lazy: true}.Formatter(T{0, 2}))
+		want := "pretty.T{y:2}"
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+	})
+
+	t.Run("map entries", func(t *testing.T) {
+		s := fmt.Sprintf("%# v", Config{Lazy: true}.Formatter(map[string]int{"a": 0, "b": 1}))
+		want := `map[string]int{"b":1}`
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+	})
+
+	t.Run("map entries skipped mid-inline leave no dangling separator", func(t *testing.T) {
+		s := fmt.Sprintf("%# v", Config{Lazy: true}.Formatter(map[string]int{"a": 1, "b": 2, "c": 0}))
+		want := `map[string]int{"a":1, "b":2}`
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+	})
+
+	t.Run("struct fields skipped mid-inline leave no dangling separator", func(t *testing.T) {
+		s := fmt.Sprintf("%# v", Config{Lazy: true}.Formatter(struct{ A, B, C int }{A: 1, B: 0, C: 2}))
+		want := `struct { A int; B int; C int }{A:1, C:2}`
+		if s != want {
+			t.Errorf("expected %q\ngot      %q", want, s)
+		}
+	})
+}
+
+func TestConfigTypeFormatters(t *testing.T) {
+	cfg := Config{TypeFormatters: map[reflect.Type]func(reflect.Value) string{
+		reflect.TypeOf(T{}): func(v reflect.Value) string { return "CUSTOM" },
+	}}
+	s := fmt.Sprintf("%# v", cfg.Formatter(SA{t: &T{1, 2}, v: T{3, 4}}))
+	want := `pretty.SA{
+    t:  &CUSTOM,
+    v:  CUSTOM,
+}`
+	if s != want {
+		t.Errorf("expected %q\ngot      %q", want, s)
+	}
+}
+
+func TestConfigNeverInline(t *testing.T) {
+	cfg := Config{NeverInline: map[reflect.Type]bool{reflect.TypeOf(T{}): true}}
+	s := fmt.Sprintf("%# v", cfg.Formatter(T{1, 2}))
+	want := `pretty.T{
+    x:  1,
+    y:  2,
+}`
+	if s != want {
+		t.Errorf("expected %q\ngot      %q", want, s)
+	}
+}
+
+func TestConfigIndentWidth(t *testing.T) {
+	cfg := Config{NeverInline: map[reflect.Type]bool{reflect.TypeOf(T{}): true}, IndentWidth: 2, UseSpaces: true}
+	s := fmt.Sprintf("%# v", cfg.Formatter(T{1, 2}))
+	want := "pretty.T{\n  x: 1,\n  y: 2,\n}"
+	if s != want {
+		t.Errorf("expected %q\ngot      %q", want, s)
+	}
+}
+
+func TestConfigConvertErrorStringObject(t *testing.T) {
+	s := fmt.Sprintf("%# v", Config{ConvertErrorStringObject: true}.Formatter(errors.New("boom")))
+	want := `errors.New("boom")`
+	if s != want {
+		t.Errorf("expected %q\ngot      %q", want, s)
+	}
+}